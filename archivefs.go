@@ -0,0 +1,354 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	stdpath "path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/zipfs"
+)
+
+// archiveEntry is one listed member of a .zip/.tar.gz, shaped like the
+// plain-directory entries /api/files already returns.
+type archiveEntry struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"` // slash-separated path within the archive
+	Size  int64  `json:"size"`
+	IsDir bool   `json:"is_dir"`
+}
+
+func isZipPath(p string) bool {
+	return strings.HasSuffix(strings.ToLower(p), ".zip")
+}
+
+func isTarGzPath(p string) bool {
+	lower := strings.ToLower(p)
+	return strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz")
+}
+
+func isBrowsableArchive(p string) bool {
+	return isZipPath(p) || isTarGzPath(p)
+}
+
+// listArchive lists the direct children of `inner` (a slash-separated
+// directory within the archive, "" for the root).
+func listArchive(archivePath, inner string) ([]archiveEntry, error) {
+	switch {
+	case isZipPath(archivePath):
+		return listZipArchive(archivePath, inner)
+	case isTarGzPath(archivePath):
+		return listTarGzArchive(archivePath, inner)
+	default:
+		return nil, fmt.Errorf("unsupported archive for virtual browsing: %s", filepath.Base(archivePath))
+	}
+}
+
+// openArchiveEntry opens a single file inside an archive for reading.
+func openArchiveEntry(archivePath, inner string) (io.ReadCloser, int64, error) {
+	switch {
+	case isZipPath(archivePath):
+		return openZipEntry(archivePath, inner)
+	case isTarGzPath(archivePath):
+		return openTarEntry(archivePath, inner)
+	default:
+		return nil, 0, fmt.Errorf("unsupported archive for virtual browsing: %s", filepath.Base(archivePath))
+	}
+}
+
+// --- zip, via afero + zipfs so browsing reuses a real afero.Fs ---
+
+func listZipArchive(archivePath, inner string) ([]archiveEntry, error) {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	fs := zipfs.New(&r.Reader)
+
+	dir := "/" + strings.Trim(inner, "/")
+	infos, err := afero.ReadDir(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]archiveEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, archiveEntry{
+			Name:  info.Name(),
+			Path:  stdpath.Join(strings.Trim(inner, "/"), info.Name()),
+			Size:  info.Size(),
+			IsDir: info.IsDir(),
+		})
+	}
+	return entries, nil
+}
+
+func openZipEntry(archivePath, inner string) (io.ReadCloser, int64, error) {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	target := strings.Trim(inner, "/")
+	for _, f := range r.File {
+		if strings.Trim(f.Name, "/") == target {
+			rc, err := f.Open()
+			if err != nil {
+				r.Close()
+				return nil, 0, err
+			}
+			return &archiveZipReader{rc: rc, parent: r}, int64(f.UncompressedSize64), nil
+		}
+	}
+	r.Close()
+	return nil, 0, fmt.Errorf("entry not found: %s", inner)
+}
+
+type archiveZipReader struct {
+	rc     io.ReadCloser
+	parent *zip.ReadCloser
+}
+
+func (z *archiveZipReader) Read(p []byte) (int, error) { return z.rc.Read(p) }
+func (z *archiveZipReader) Close() error {
+	z.rc.Close()
+	return z.parent.Close()
+}
+
+// --- tar.gz, via a directory index cached on first access ---
+//
+// gzip streams aren't seekable, so we can't offer true random access.
+// Instead the first list/read builds an in-memory index of entry
+// name/size/mode, and subsequent requests reuse it for listing; reading
+// a file still re-scans the stream up to the matching entry.
+
+type tarIndexEntry struct {
+	Name  string
+	Size  int64
+	IsDir bool
+}
+
+var tarIndexCache = struct {
+	mu sync.Mutex
+	m  map[string][]tarIndexEntry
+}{m: make(map[string][]tarIndexEntry)}
+
+func tarIndexFor(archivePath string) ([]tarIndexEntry, error) {
+	tarIndexCache.mu.Lock()
+	if idx, ok := tarIndexCache.m[archivePath]; ok {
+		tarIndexCache.mu.Unlock()
+		return idx, nil
+	}
+	tarIndexCache.mu.Unlock()
+
+	idx, err := buildTarIndex(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	tarIndexCache.mu.Lock()
+	tarIndexCache.m[archivePath] = idx
+	tarIndexCache.mu.Unlock()
+	return idx, nil
+}
+
+func buildTarIndex(archivePath string) ([]tarIndexEntry, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gzr.Close()
+
+	tr := tar.NewReader(gzr)
+	var idx []tarIndexEntry
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		idx = append(idx, tarIndexEntry{Name: strings.Trim(h.Name, "/"), Size: h.Size, IsDir: h.Typeflag == tar.TypeDir})
+	}
+	return idx, nil
+}
+
+func listTarGzArchive(archivePath, inner string) ([]archiveEntry, error) {
+	idx, err := tarIndexFor(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	dir := strings.Trim(inner, "/")
+
+	seen := make(map[string]bool)
+	var entries []archiveEntry
+	for _, e := range idx {
+		if e.Name == dir || e.Name == "" {
+			continue
+		}
+		if dir != "" && !strings.HasPrefix(e.Name, dir+"/") {
+			continue
+		}
+		rel := e.Name
+		if dir != "" {
+			rel = strings.TrimPrefix(rel, dir+"/")
+		}
+		if rel == "" {
+			continue
+		}
+
+		if slash := strings.Index(rel, "/"); slash != -1 {
+			top := rel[:slash]
+			full := stdpath.Join(dir, top)
+			if seen[full] {
+				continue
+			}
+			seen[full] = true
+			entries = append(entries, archiveEntry{Name: top, Path: full, IsDir: true})
+			continue
+		}
+		if seen[e.Name] {
+			continue
+		}
+		seen[e.Name] = true
+		entries = append(entries, archiveEntry{Name: rel, Path: e.Name, Size: e.Size, IsDir: e.IsDir})
+	}
+	return entries, nil
+}
+
+func openTarEntry(archivePath, inner string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	tr := tar.NewReader(gzr)
+	target := strings.Trim(inner, "/")
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			gzr.Close()
+			f.Close()
+			return nil, 0, err
+		}
+		if strings.Trim(h.Name, "/") == target {
+			return &archiveTarReader{tr: tr, gzr: gzr, f: f}, h.Size, nil
+		}
+	}
+	gzr.Close()
+	f.Close()
+	return nil, 0, fmt.Errorf("entry not found: %s", inner)
+}
+
+type archiveTarReader struct {
+	tr  *tar.Reader
+	gzr *gzip.Reader
+	f   *os.File
+}
+
+func (t *archiveTarReader) Read(p []byte) (int, error) { return t.tr.Read(p) }
+func (t *archiveTarReader) Close() error {
+	t.gzr.Close()
+	return t.f.Close()
+}
+
+// --- routes ---
+
+// splitArchiveBoundary walks the segments of a /api/files-style relative
+// path and returns the first prefix that names an actual archive file on
+// disk, plus whatever comes after it, so the file browser can descend
+// into an archive exactly like it descends into a directory.
+func splitArchiveBoundary(reqDir string) (archiveRel, inner string, ok bool) {
+	clean := filepath.ToSlash(filepath.Clean(reqDir))
+	if clean == "." {
+		return "", "", false
+	}
+	parts := strings.Split(clean, "/")
+	for i := 1; i <= len(parts); i++ {
+		candidate := strings.Join(parts[:i], "/")
+		if !isBrowsableArchive(candidate) {
+			continue
+		}
+		full := filepath.Join("./downloads", candidate)
+		if info, err := os.Stat(full); err == nil && !info.IsDir() {
+			return candidate, strings.Join(parts[i:], "/"), true
+		}
+	}
+	return "", "", false
+}
+
+func handleArchiveList(c *gin.Context) {
+	relPath := c.Query("path")
+	inner := c.Query("inner")
+	archivePath := filepath.Join("./downloads", relPath)
+	if !strings.HasPrefix(filepath.Clean(archivePath), filepath.Clean("./downloads")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+		return
+	}
+
+	entries, err := listArchive(archivePath, inner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"path": relPath, "inner": inner, "entries": entries})
+}
+
+// handleRawArchive serves GET /raw-archive/<archive>!/<inner path>,
+// buffering the (typically small, already-compressed) entry so we can
+// hand it to http.ServeContent for Range support and Content-Type
+// sniffing, same as the static /raw handler gets for free from net/http.
+func handleRawArchive(c *gin.Context) {
+	full := strings.TrimPrefix(c.Param("archivePath"), "/")
+	const sep = "!/"
+	idx := strings.Index(full, sep)
+	if idx == -1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expected /raw-archive/<archive>!/<inner path>"})
+		return
+	}
+	archiveRel := full[:idx]
+	inner := full[idx+len(sep):]
+
+	archivePath := filepath.Join("./downloads", archiveRel)
+	if !strings.HasPrefix(filepath.Clean(archivePath), filepath.Clean("./downloads")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+		return
+	}
+
+	rc, _, err := openArchiveEntry(archivePath, inner)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	http.ServeContent(c.Writer, c.Request, filepath.Base(inner), time.Time{}, bytes.NewReader(data))
+}
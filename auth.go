@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resultURLTTL is how long a signed result link stays valid before a
+// client has to re-fetch the job to get a fresh one.
+const resultURLTTL = 24 * time.Hour
+
+func adminToken() string { return os.Getenv("ADMIN_TOKEN") }
+
+func signingSecret() string {
+	if s := os.Getenv("SIGNING_SECRET"); s != "" {
+		return s
+	}
+	return adminToken()
+}
+
+// authRequired reports whether an admin token has been configured. When
+// it hasn't, auth and URL signing are both left open so plain local
+// usage (the original behavior) is unaffected.
+func authRequired() bool { return adminToken() != "" }
+
+func subtleEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// requireAdminToken guards /api/*. It accepts a bearer token, or HTTP
+// Basic Auth (any username, password = the token) as a browser-friendly
+// alternative since browsers can't set custom headers on a plain link.
+func requireAdminToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authRequired() {
+			c.Next()
+			return
+		}
+		if authHeaderOK(c.GetHeader("Authorization"), adminToken()) {
+			c.Next()
+			return
+		}
+		c.Header("WWW-Authenticate", `Basic realm="decompress-dl"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	}
+}
+
+func authHeaderOK(header, token string) bool {
+	switch {
+	case strings.HasPrefix(header, "Bearer "):
+		return subtleEqual(strings.TrimPrefix(header, "Bearer "), token)
+	case strings.HasPrefix(header, "Basic "):
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+		if err != nil {
+			return false
+		}
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return false
+		}
+		return subtleEqual(parts[1], token)
+	default:
+		return false
+	}
+}
+
+// --- signed, expiring URLs for /raw and /raw-archive ---
+
+func hmacSign(path string, exp int64) string {
+	mac := hmac.New(sha256.New, []byte(signingSecret()))
+	fmt.Fprintf(mac, "%s:%d", path, exp)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signResultURL turns a plain /raw/<path> into /raw/<path>?exp=<unix>&sig=<hmac>
+// when an admin token is configured; otherwise the URL is returned as-is.
+func signResultURL(rawURL string, ttl time.Duration) string {
+	if !authRequired() {
+		return rawURL
+	}
+	exp := time.Now().Add(ttl).Unix()
+	return fmt.Sprintf("%s?exp=%d&sig=%s", rawURL, exp, hmacSign(rawURL, exp))
+}
+
+func verifySignedURL(path, expStr, sig string) bool {
+	if expStr == "" || sig == "" {
+		return false
+	}
+	exp, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return subtleEqual(hmacSign(path, exp), sig)
+}
+
+// requireSignedURL gates static file serving under /raw and
+// /raw-archive. A no-op when no admin token is configured, same as
+// requireAdminToken, so local usage keeps working unsigned.
+func requireSignedURL() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authRequired() {
+			c.Next()
+			return
+		}
+		if verifySignedURL(c.Request.URL.Path, c.Query("exp"), c.Query("sig")) {
+			c.Next()
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing or invalid signature"})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func withAdminToken(t *testing.T, token string) {
+	t.Helper()
+	t.Setenv("ADMIN_TOKEN", token)
+}
+
+func TestHmacSignIsDeterministicAndPathSensitive(t *testing.T) {
+	withAdminToken(t, "s3cret")
+
+	exp := time.Now().Add(time.Hour).Unix()
+	a := hmacSign("/raw/foo.zip", exp)
+	b := hmacSign("/raw/foo.zip", exp)
+	if a != b {
+		t.Fatalf("hmacSign not deterministic: %q != %q", a, b)
+	}
+	if c := hmacSign("/raw/bar.zip", exp); c == a {
+		t.Fatalf("hmacSign should differ for a different path")
+	}
+	if c := hmacSign("/raw/foo.zip", exp+1); c == a {
+		t.Fatalf("hmacSign should differ for a different expiry")
+	}
+}
+
+func TestVerifySignedURLAcceptsValidSignature(t *testing.T) {
+	withAdminToken(t, "s3cret")
+
+	path := "/raw/foo.zip"
+	exp := time.Now().Add(time.Hour).Unix()
+	sig := hmacSign(path, exp)
+
+	if !verifySignedURL(path, strconv.FormatInt(exp, 10), sig) {
+		t.Fatal("expected valid signature to verify")
+	}
+}
+
+func TestVerifySignedURLRejectsExpired(t *testing.T) {
+	withAdminToken(t, "s3cret")
+
+	path := "/raw/foo.zip"
+	exp := time.Now().Add(-time.Hour).Unix()
+	sig := hmacSign(path, exp)
+
+	if verifySignedURL(path, strconv.FormatInt(exp, 10), sig) {
+		t.Fatal("expected expired signature to be rejected")
+	}
+}
+
+func TestVerifySignedURLRejectsTamperedPath(t *testing.T) {
+	withAdminToken(t, "s3cret")
+
+	exp := time.Now().Add(time.Hour).Unix()
+	sig := hmacSign("/raw/foo.zip", exp)
+
+	if verifySignedURL("/raw/other.zip", strconv.FormatInt(exp, 10), sig) {
+		t.Fatal("expected signature for a different path to be rejected")
+	}
+}
+
+func TestVerifySignedURLRejectsMissingParams(t *testing.T) {
+	withAdminToken(t, "s3cret")
+
+	if verifySignedURL("/raw/foo.zip", "", "") {
+		t.Fatal("expected missing exp/sig to be rejected")
+	}
+}
+
+func TestSignResultURLNoopWithoutAdminToken(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "")
+
+	raw := "/raw/foo.zip"
+	if got := signResultURL(raw, resultURLTTL); got != raw {
+		t.Fatalf("expected unsigned URL when no admin token is set, got %q", got)
+	}
+}
+
+func TestSignResultURLAppendsValidSignature(t *testing.T) {
+	withAdminToken(t, "s3cret")
+
+	raw := "/raw/foo.zip"
+	signed := signResultURL(raw, resultURLTTL)
+	if signed == raw {
+		t.Fatal("expected signed URL to differ from raw URL")
+	}
+}
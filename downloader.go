@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DownloadOptions are the knobs exposed on POST /api/download for tuning
+// the segmented fetch.
+type DownloadOptions struct {
+	Segments   int  // number of parallel range chunks; <=1 means single-stream
+	Resume     bool // reuse an existing .part.json manifest if one matches
+	MaxRetries int  // per-chunk retry attempts before the job fails
+}
+
+// rangeChunk tracks one byte range of a segmented download and how much
+// of it has been written so far, so a chunk can resume mid-range.
+type rangeChunk struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"` // inclusive
+	Done  int64 `json:"done"`
+}
+
+func (c rangeChunk) size() int64 { return c.End - c.Start + 1 }
+
+// downloadManifest is the sidecar ".part.json" that lets an interrupted
+// segmented download resume from disk instead of restarting.
+type downloadManifest struct {
+	URL    string       `json:"url"`
+	Path   string       `json:"path"`
+	Total  int64        `json:"total"`
+	Chunks []rangeChunk `json:"chunks"`
+}
+
+func partsDirFor(jobID string) string {
+	return filepath.Join("./data", "parts", jobID)
+}
+
+func manifestPathFor(jobID string) string {
+	return filepath.Join(partsDirFor(jobID), "manifest.json")
+}
+
+func loadManifest(path string) (*downloadManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m downloadManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func saveManifest(path string, m *downloadManifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// probeDownload discovers the remote size and whether byte-range
+// requests are supported, preferring a HEAD and falling back to a
+// `Range: bytes=0-0` GET for servers that don't implement HEAD.
+func probeDownload(url string) (total int64, acceptRanges bool, suggestedName string, err error) {
+	if resp, herr := http.Head(url); herr == nil && resp.StatusCode < 400 {
+		defer resp.Body.Close()
+		return resp.ContentLength, resp.Header.Get("Accept-Ranges") == "bytes", filenameFromResponse(resp), nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0, false, "", err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, false, "", err
+	}
+	defer resp.Body.Close()
+
+	acceptRanges = resp.StatusCode == http.StatusPartialContent
+	if cr := resp.Header.Get("Content-Range"); cr != "" {
+		if idx := strings.LastIndex(cr, "/"); idx != -1 {
+			total, _ = strconv.ParseInt(cr[idx+1:], 10, 64)
+		}
+	} else {
+		total = resp.ContentLength
+	}
+	return total, acceptRanges, filenameFromResponse(resp), nil
+}
+
+func filenameFromResponse(resp *http.Response) string {
+	if cd := resp.Header.Get("Content-Disposition"); cd != "" {
+		if _, params, err := mime.ParseMediaType(cd); err == nil && params["filename"] != "" {
+			return params["filename"]
+		}
+	}
+	return filepath.Base(resp.Request.URL.Path)
+}
+
+func resolveFilename(customName, suggested string) string {
+	name := customName
+	if name == "" {
+		name = suggested
+	}
+	if name == "" || name == "." || name == "/" {
+		name = "download_" + uuid.New().String()
+	}
+	return filepath.Base(name)
+}
+
+func buildManifest(url, path string, total int64, segments int) *downloadManifest {
+	m := &downloadManifest{URL: url, Path: path, Total: total}
+	chunkSize := total / int64(segments)
+	start := int64(0)
+	for i := 0; i < segments; i++ {
+		end := start + chunkSize - 1
+		if i == segments-1 {
+			end = total - 1
+		}
+		m.Chunks = append(m.Chunks, rangeChunk{Start: start, End: end})
+		start = end + 1
+	}
+	return m
+}
+
+func sumDone(chunks []rangeChunk) int64 {
+	var total int64
+	for _, c := range chunks {
+		total += c.Done
+	}
+	return total
+}
+
+// downloadWithOptions fetches url into destFolder, using N parallel
+// Range-request chunks with per-chunk retry/backoff when the server
+// supports it, resuming from a prior manifest when asked, and falling
+// back to the plain single-stream downloadFile otherwise.
+func downloadWithOptions(jobID, url, customName, destFolder string, opts DownloadOptions) (string, error) {
+	total, acceptRanges, suggestedName, err := probeDownload(url)
+	segments := opts.Segments
+	if err != nil || !acceptRanges || total <= 0 || segments <= 1 {
+		return downloadFile(jobID, url, customName, destFolder)
+	}
+
+	maxRetries := opts.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = 3
+	}
+
+	finalPath := filepath.Join(destFolder, resolveFilename(customName, suggestedName))
+	partsDir := partsDirFor(jobID)
+	os.MkdirAll(partsDir, 0755)
+	manifestFile := manifestPathFor(jobID)
+
+	var manifest *downloadManifest
+	if opts.Resume {
+		if m, merr := loadManifest(manifestFile); merr == nil && m.URL == url && m.Total == total {
+			manifest = m
+		}
+	}
+	if manifest == nil {
+		manifest = buildManifest(url, finalPath, total, segments)
+		f, cerr := os.Create(finalPath)
+		if cerr != nil {
+			return "", cerr
+		}
+		if err := f.Truncate(total); err != nil {
+			f.Close()
+			return "", err
+		}
+		f.Close()
+		if err := saveManifest(manifestFile, manifest); err != nil {
+			return "", err
+		}
+	}
+
+	var (
+		mu         sync.Mutex
+		wg         sync.WaitGroup
+		doneBytes  = sumDone(manifest.Chunks)
+		start      = time.Now()
+		lastReport = start
+		firstErr   error
+	)
+
+	// reportProgress also owns writes to chunk.Done: it's read back out
+	// wholesale by saveManifest below, so every chunk goroutine's writes
+	// to its own chunk.Done must go through the same mutex as that read.
+	reportProgress := func(chunk *rangeChunk, n int64) {
+		mu.Lock()
+		chunk.Done += n
+		doneBytes += n
+		now := time.Now()
+		shouldReport := now.Sub(lastReport) >= progressThrottle
+		db := doneBytes
+		if shouldReport {
+			lastReport = now
+		}
+		saveManifest(manifestFile, manifest)
+		mu.Unlock()
+
+		if !shouldReport {
+			return
+		}
+		elapsed := now.Sub(start).Seconds()
+		rate := 0.0
+		if elapsed > 0 {
+			rate = float64(db) / elapsed
+		}
+		ev := ProgressEvent{Stage: "download", BytesDone: db, BytesTotal: total, RateBps: rate}
+		if total > 0 {
+			ev.Percent = float64(db) / float64(total) * 100
+			if rate > 0 {
+				ev.ETASeconds = float64(total-db) / rate
+			}
+		}
+		updateJobProgress(jobID, ev)
+	}
+
+	for i := range manifest.Chunks {
+		chunk := &manifest.Chunks[i]
+		if chunk.Done >= chunk.size() {
+			continue
+		}
+		wg.Add(1)
+		go func(chunk *rangeChunk) {
+			defer wg.Done()
+			if err := fetchChunkWithRetry(url, finalPath, chunk, maxRetries, reportProgress); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(chunk)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return "", firstErr
+	}
+
+	updateJobProgress(jobID, ProgressEvent{Stage: "download", BytesDone: total, BytesTotal: total, Percent: 100, Done: true})
+	os.RemoveAll(partsDir)
+	return finalPath, nil
+}
+
+func fetchChunkWithRetry(url, path string, chunk *rangeChunk, maxRetries int, onProgress func(*rangeChunk, int64)) error {
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt*attempt) * 500 * time.Millisecond)
+		}
+		if err := fetchChunk(url, path, chunk, onProgress); err == nil {
+			return nil
+		} else {
+			lastErr = err
+		}
+	}
+	return fmt.Errorf("chunk %d-%d failed after %d retries: %w", chunk.Start, chunk.End, maxRetries, lastErr)
+}
+
+func fetchChunk(url, path string, chunk *rangeChunk, onProgress func(*rangeChunk, int64)) error {
+	rangeStart := chunk.Start + chunk.Done
+	if rangeStart > chunk.End {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", rangeStart, chunk.End))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d for range request", resp.StatusCode)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(rangeStart, io.SeekStart); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, rerr := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := f.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			onProgress(chunk, int64(n))
+		}
+		if rerr == io.EOF {
+			return nil
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestBuildManifestSplitsRangesContiguously(t *testing.T) {
+	m := buildManifest("http://example.com/f.zip", "f.zip", 100, 3)
+
+	if len(m.Chunks) != 3 {
+		t.Fatalf("expected 3 chunks, got %d", len(m.Chunks))
+	}
+	if m.Chunks[0].Start != 0 {
+		t.Fatalf("expected first chunk to start at 0, got %d", m.Chunks[0].Start)
+	}
+	if last := m.Chunks[len(m.Chunks)-1].End; last != 99 {
+		t.Fatalf("expected last chunk to end at 99, got %d", last)
+	}
+	for i := 1; i < len(m.Chunks); i++ {
+		if m.Chunks[i].Start != m.Chunks[i-1].End+1 {
+			t.Fatalf("chunk %d does not pick up where chunk %d left off: %+v", i, i-1, m.Chunks)
+		}
+	}
+}
+
+func TestBuildManifestSingleSegmentCoversWholeFile(t *testing.T) {
+	m := buildManifest("http://example.com/f.zip", "f.zip", 42, 1)
+
+	if len(m.Chunks) != 1 {
+		t.Fatalf("expected 1 chunk, got %d", len(m.Chunks))
+	}
+	if m.Chunks[0].Start != 0 || m.Chunks[0].End != 41 {
+		t.Fatalf("expected chunk to cover [0,41], got %+v", m.Chunks[0])
+	}
+}
+
+func TestSumDoneAddsUpChunkProgress(t *testing.T) {
+	chunks := []rangeChunk{{Start: 0, End: 9, Done: 10}, {Start: 10, End: 19, Done: 5}}
+	if got := sumDone(chunks); got != 15 {
+		t.Fatalf("expected sumDone to be 15, got %d", got)
+	}
+}
+
+func TestResolveFilenameFallsBackToGenerated(t *testing.T) {
+	if got := resolveFilename("", ""); got == "" {
+		t.Fatal("expected a generated fallback name, got empty string")
+	}
+	if got := resolveFilename("custom.zip", "suggested.zip"); got != "custom.zip" {
+		t.Fatalf("expected custom name to win, got %q", got)
+	}
+	if got := resolveFilename("", "suggested.zip"); got != "suggested.zip" {
+		t.Fatalf("expected suggested name when no custom name given, got %q", got)
+	}
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Extractor knows how to recognize one archive format by its leading
+// bytes (not by file extension, so a mislabeled .zip that's actually a
+// RAR still routes to the right backend) and unpack it into a directory.
+type Extractor interface {
+	Name() string
+	Sniff(magic []byte, filename string) bool
+	Extract(jobID, source, dest string) error
+}
+
+var extractors []Extractor
+
+func registerExtractor(e Extractor) {
+	extractors = append(extractors, e)
+}
+
+func init() {
+	registerExtractor(zipExtractor{})
+	registerExtractor(sevenZipExtractor{})
+	registerExtractor(rarExtractor{})
+	registerExtractor(gzipExtractor{})
+	registerExtractor(bzip2Extractor{})
+	registerExtractor(xzExtractor{})
+	registerExtractor(zstdExtractor{})
+}
+
+// detectExtractor peeks the first 512 bytes of source and returns the
+// first registered Extractor that claims to recognize them.
+func detectExtractor(source string) (Extractor, error) {
+	f, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 512)
+	n, _ := io.ReadFull(f, magic)
+	magic = magic[:n]
+
+	for _, e := range extractors {
+		if e.Sniff(magic, source) {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("unrecognized archive format: %s", filepath.Base(source))
+}
+
+// stripArchiveExt removes a known (possibly multi-part) archive suffix
+// so the extraction destination folder gets a sensible name.
+func stripArchiveExt(path string) string {
+	lower := strings.ToLower(path)
+	for _, suf := range []string{".tar.gz", ".tar.bz2", ".tar.xz", ".tar.zst", ".tar", ".tgz"} {
+		if strings.HasSuffix(lower, suf) {
+			return path[:len(path)-len(suf)]
+		}
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+// --- zip ---
+
+type zipExtractor struct{}
+
+func (zipExtractor) Name() string { return "zip" }
+
+func (zipExtractor) Sniff(magic []byte, filename string) bool {
+	return len(magic) >= 4 && magic[0] == 'P' && magic[1] == 'K' && (magic[2] == 3 || magic[2] == 5 || magic[2] == 7)
+}
+
+func (zipExtractor) Extract(jobID, source, dest string) error {
+	return unzipSource(jobID, source, dest)
+}
+
+// --- rar ---
+
+var rarMagic = []byte{0x52, 0x61, 0x72, 0x21, 0x1A, 0x07}
+
+type rarExtractor struct{}
+
+func (rarExtractor) Name() string { return "rar" }
+
+func (rarExtractor) Sniff(magic []byte, filename string) bool {
+	return bytes.HasPrefix(magic, rarMagic)
+}
+
+func (rarExtractor) Extract(jobID, source, dest string) error {
+	return unrarSource(source, dest)
+}
+
+// --- 7z ---
+
+var sevenZipMagic = []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}
+
+type sevenZipExtractor struct{}
+
+func (sevenZipExtractor) Name() string { return "7z" }
+
+func (sevenZipExtractor) Sniff(magic []byte, filename string) bool {
+	return bytes.HasPrefix(magic, sevenZipMagic)
+}
+
+func (sevenZipExtractor) Extract(jobID, source, dest string) error {
+	r, err := sevenzip.OpenReader(source)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	os.MkdirAll(dest, 0755)
+
+	var total int64
+	for _, f := range r.File {
+		total += int64(f.UncompressedSize)
+	}
+	var done int64
+	lastReport := time.Now()
+
+	for _, f := range r.File {
+		fpath, err := sanitizePath(dest, f.Name)
+		if err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			os.MkdirAll(fpath, os.ModePerm)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+			return err
+		}
+		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+		if err != nil {
+			return err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			outFile.Close()
+			return err
+		}
+		n, err := io.Copy(outFile, rc)
+		outFile.Close()
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		done += n
+		if now := time.Now(); now.Sub(lastReport) >= progressThrottle {
+			lastReport = now
+			ev := ProgressEvent{Stage: "extract", BytesDone: done, BytesTotal: total}
+			if total > 0 {
+				ev.Percent = float64(done) / float64(total) * 100
+			}
+			updateJobProgress(jobID, ev)
+		}
+	}
+	updateJobProgress(jobID, ProgressEvent{Stage: "extract", BytesDone: done, BytesTotal: total, Percent: 100, Done: true})
+	return nil
+}
+
+// --- single-stream compressors: gzip, bzip2, xz, zstd ---
+//
+// Each of these can wrap either a tar stream (.tar.gz, .tar.bz2, ...) or
+// a single plain file (.gz, .bz2, ...). We peek the decompressed stream
+// for a "ustar" tar header instead of trusting the filename.
+
+type gzipExtractor struct{}
+
+func (gzipExtractor) Name() string { return "gzip" }
+
+func (gzipExtractor) Sniff(magic []byte, filename string) bool {
+	return len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+func (gzipExtractor) Extract(jobID, source, dest string) error {
+	f, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gzr.Close()
+	return extractCompressedSingleOrTar(jobID, gzr, dest, source)
+}
+
+type bzip2Extractor struct{}
+
+func (bzip2Extractor) Name() string { return "bzip2" }
+
+func (bzip2Extractor) Sniff(magic []byte, filename string) bool {
+	return bytes.HasPrefix(magic, []byte("BZh"))
+}
+
+func (bzip2Extractor) Extract(jobID, source, dest string) error {
+	f, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return extractCompressedSingleOrTar(jobID, bzip2.NewReader(f), dest, source)
+}
+
+var xzMagic = []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}
+
+type xzExtractor struct{}
+
+func (xzExtractor) Name() string { return "xz" }
+
+func (xzExtractor) Sniff(magic []byte, filename string) bool {
+	return bytes.HasPrefix(magic, xzMagic)
+}
+
+func (xzExtractor) Extract(jobID, source, dest string) error {
+	f, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	xzr, err := xz.NewReader(f)
+	if err != nil {
+		return err
+	}
+	return extractCompressedSingleOrTar(jobID, xzr, dest, source)
+}
+
+var zstdMagic = []byte{0x28, 0xB5, 0x2F, 0xFD}
+
+type zstdExtractor struct{}
+
+func (zstdExtractor) Name() string { return "zstd" }
+
+func (zstdExtractor) Sniff(magic []byte, filename string) bool {
+	return bytes.HasPrefix(magic, zstdMagic)
+}
+
+func (zstdExtractor) Extract(jobID, source, dest string) error {
+	f, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	return extractCompressedSingleOrTar(jobID, zr, dest, source)
+}
+
+// peekIsTar reads up to 512 bytes from r and checks for the "ustar"
+// magic at its fixed tar-header offset, returning a reader that still
+// sees every byte that was peeked.
+func peekIsTar(r io.Reader) (bool, io.Reader) {
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(r, buf)
+	buf = buf[:n]
+	isTar := n >= 262 && string(buf[257:262]) == "ustar"
+	return isTar, io.MultiReader(bytes.NewReader(buf), r)
+}
+
+func extractCompressedSingleOrTar(jobID string, decompressed io.Reader, dest, sourceFilename string) error {
+	isTar, combined := peekIsTar(decompressed)
+	if isTar {
+		return extractTarStream(jobID, tar.NewReader(combined), dest)
+	}
+
+	os.MkdirAll(dest, 0755)
+	outName := strings.TrimSuffix(filepath.Base(sourceFilename), filepath.Ext(sourceFilename))
+	outFile, err := os.Create(filepath.Join(dest, outName))
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	pr := newProgressReader(combined, "extract", 0, func(ev ProgressEvent) {
+		updateJobProgress(jobID, ev)
+	})
+	if _, err := io.Copy(outFile, pr); err != nil {
+		return err
+	}
+	updateJobProgress(jobID, ProgressEvent{Stage: "extract", Percent: 100, Done: true})
+	return nil
+}
+
+// --- Archive: the reverse direction, folder -> .zip or .tar.gz ---
+
+// Archiver packs a directory under ./downloads into a single archive
+// file, the mirror image of Extractor.
+type Archiver interface {
+	Format() string
+	Archive(jobID, sourceDir, destFolder string) (string, error)
+}
+
+var archivers = map[string]Archiver{}
+
+func registerArchiver(a Archiver) {
+	archivers[a.Format()] = a
+}
+
+func init() {
+	registerArchiver(zipArchiver{})
+	registerArchiver(targzArchiver{})
+}
+
+func archiveFolder(jobID, sourceDir, destFolder, format string) (string, error) {
+	a, ok := archivers[strings.ToLower(format)]
+	if !ok {
+		return "", fmt.Errorf("unsupported archive format: %s", format)
+	}
+	return a.Archive(jobID, sourceDir, destFolder)
+}
+
+type zipArchiver struct{}
+
+func (zipArchiver) Format() string { return "zip" }
+
+func (zipArchiver) Archive(jobID, sourceDir, destFolder string) (string, error) {
+	outPath := filepath.Join(destFolder, filepath.Base(sourceDir)+".zip")
+	outFile, err := os.Create(outPath)
+	if err != nil {
+		return "", err
+	}
+	defer outFile.Close()
+	w := zip.NewWriter(outFile)
+	defer w.Close()
+
+	err = filepath.Walk(sourceDir, func(path string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		rel, err := filepath.Rel(sourceDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if info.IsDir() {
+			_, err := w.Create(rel + "/")
+			return err
+		}
+		fw, err := w.Create(rel)
+		if err != nil {
+			return err
+		}
+		srcFile, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer srcFile.Close()
+		pr := newProgressReader(srcFile, "archive", info.Size(), func(ev ProgressEvent) {
+			updateJobProgress(jobID, ev)
+		})
+		_, err = io.Copy(fw, pr)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	updateJobProgress(jobID, ProgressEvent{Stage: "archive", Percent: 100, Done: true})
+	return outPath, nil
+}
+
+type targzArchiver struct{}
+
+func (targzArchiver) Format() string { return "tar.gz" }
+
+func (targzArchiver) Archive(jobID, sourceDir, destFolder string) (string, error) {
+	outPath := filepath.Join(destFolder, filepath.Base(sourceDir)+".tar.gz")
+	outFile, err := os.Create(outPath)
+	if err != nil {
+		return "", err
+	}
+	defer outFile.Close()
+	gzw := gzip.NewWriter(outFile)
+	defer gzw.Close()
+	tw := tar.NewWriter(gzw)
+	defer tw.Close()
+
+	err = filepath.Walk(sourceDir, func(path string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		rel, err := filepath.Rel(sourceDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		srcFile, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer srcFile.Close()
+		pr := newProgressReader(srcFile, "archive", info.Size(), func(ev ProgressEvent) {
+			updateJobProgress(jobID, ev)
+		})
+		_, err = io.Copy(tw, pr)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	updateJobProgress(jobID, ProgressEvent{Stage: "archive", Percent: 100, Done: true})
+	return outPath, nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// JobRecord is what actually gets persisted: the Job plus the payload it
+// was submitted with, so an interrupted job can be resumed after a
+// restart without the client re-sending the request.
+type JobRecord struct {
+	Job     Job                    `json:"job"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+// JobStore is the persistence boundary for jobs. The in-memory sync.Map
+// this replaces couldn't survive a restart; bbolt gives us that for
+// free while keeping the same load/store/list shape.
+type JobStore interface {
+	Put(rec JobRecord) error
+	Get(id string) (JobRecord, bool)
+	Delete(id string) error
+	List(statusFilter JobStatus, typeFilter string, since time.Time) []JobRecord
+	Close() error
+}
+
+var jobsBucket = []byte("jobs")
+
+// --- bbolt-backed store (default) ---
+
+type boltJobStore struct {
+	db *bbolt.DB
+}
+
+func newBoltJobStore(path string) (*boltJobStore, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(jobsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltJobStore{db: db}, nil
+}
+
+func (s *boltJobStore) Put(rec JobRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put([]byte(rec.Job.ID), data)
+	})
+}
+
+func (s *boltJobStore) Get(id string) (JobRecord, bool) {
+	var rec JobRecord
+	found := false
+	s.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(jobsBucket).Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		if err := json.Unmarshal(v, &rec); err == nil {
+			found = true
+		}
+		return nil
+	})
+	return rec, found
+}
+
+func (s *boltJobStore) Delete(id string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(jobsBucket).Delete([]byte(id))
+	})
+}
+
+func (s *boltJobStore) List(statusFilter JobStatus, typeFilter string, since time.Time) []JobRecord {
+	var out []JobRecord
+	s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(k, v []byte) error {
+			var rec JobRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return nil
+			}
+			if matchesJobFilter(rec.Job, statusFilter, typeFilter, since) {
+				out = append(out, rec)
+			}
+			return nil
+		})
+	})
+	return out
+}
+
+func (s *boltJobStore) Close() error { return s.db.Close() }
+
+// --- in-memory fallback, used if the bbolt file can't be opened ---
+
+type memoryJobStore struct {
+	mu sync.RWMutex
+	m  map[string]JobRecord
+}
+
+func newMemoryJobStore() *memoryJobStore {
+	return &memoryJobStore{m: make(map[string]JobRecord)}
+}
+
+func (s *memoryJobStore) Put(rec JobRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[rec.Job.ID] = rec
+	return nil
+}
+
+func (s *memoryJobStore) Get(id string) (JobRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.m[id]
+	return rec, ok
+}
+
+func (s *memoryJobStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, id)
+	return nil
+}
+
+func (s *memoryJobStore) List(statusFilter JobStatus, typeFilter string, since time.Time) []JobRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []JobRecord
+	for _, rec := range s.m {
+		if matchesJobFilter(rec.Job, statusFilter, typeFilter, since) {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+func (s *memoryJobStore) Close() error { return nil }
+
+func matchesJobFilter(job Job, statusFilter JobStatus, typeFilter string, since time.Time) bool {
+	if statusFilter != "" && job.Status != statusFilter {
+		return false
+	}
+	if typeFilter != "" && job.Type != typeFilter {
+		return false
+	}
+	if !since.IsZero() && job.UpdatedAt.Before(since) {
+		return false
+	}
+	return true
+}
+
+// --- crash recovery & retention ---
+
+// resumableJobTypes are the job types whose inputs live on disk, so a
+// job left pending/processing when the process died can simply be
+// reprocessed from scratch.
+var resumableJobTypes = map[string]bool{
+	"download": true,
+	"extract":  true,
+	"remux":    true,
+	"archive":  true,
+}
+
+// processJobFunc is processJob, indirected so recoverInterruptedJobs can be
+// unit tested without spinning up a real download/extract/etc.
+var processJobFunc = processJob
+
+// recoverInterruptedJobs runs once at startup: jobs still pending or
+// processing didn't survive whatever killed the previous process, so we
+// either resume them or mark them failed.
+func recoverInterruptedJobs(store JobStore) {
+	for _, rec := range store.List("", "", time.Time{}) {
+		if rec.Job.Status != StatusPending && rec.Job.Status != StatusProcessing {
+			continue
+		}
+		if resumableJobTypes[rec.Job.Type] {
+			go processJobFunc(rec.Job, rec.Payload)
+			continue
+		}
+		rec.Job.Status = StatusFailed
+		rec.Job.Details = "interrupted by restart"
+		rec.Job.UpdatedAt = time.Now()
+		store.Put(rec)
+	}
+}
+
+// pruneLoop periodically deletes completed/failed job records (and
+// their result files under ./downloads) older than retention, so a
+// long-running deployment doesn't leak job history or disk space.
+func pruneLoop(store JobStore, retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		pruneOnce(store, retention)
+	}
+}
+
+func pruneOnce(store JobStore, retention time.Duration) {
+	cutoff := time.Now().Add(-retention)
+	for _, rec := range store.List("", "", time.Time{}) {
+		if rec.Job.Status != StatusCompleted && rec.Job.Status != StatusFailed {
+			continue
+		}
+		if rec.Job.UpdatedAt.After(cutoff) {
+			continue
+		}
+		if rec.Job.ResultURL != "" {
+			// ResultURL may carry a signed "?exp=...&sig=..." suffix
+			// (see signResultURL); strip it before deriving the on-disk
+			// path or the file is never found and never removed.
+			path, _, _ := strings.Cut(rec.Job.ResultURL, "?")
+			if rel := strings.TrimPrefix(path, "/raw/"); rel != path {
+				os.RemoveAll(filepath.Join("./downloads", rel))
+			}
+		}
+		store.Delete(rec.Job.ID)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecoverInterruptedJobsResumesResumableTypes(t *testing.T) {
+	var mu sync.Mutex
+	var resumed []string
+	orig := processJobFunc
+	processJobFunc = func(job Job, payload map[string]interface{}) {
+		mu.Lock()
+		resumed = append(resumed, job.ID)
+		mu.Unlock()
+	}
+	t.Cleanup(func() { processJobFunc = orig })
+
+	store := newMemoryJobStore()
+	store.Put(JobRecord{Job: Job{ID: "dl-1", Type: "download", Status: StatusProcessing}})
+
+	recoverInterruptedJobs(store)
+
+	// processJobFunc runs in its own goroutine; give it a moment to land.
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := len(resumed)
+		mu.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(resumed) != 1 || resumed[0] != "dl-1" {
+		t.Fatalf("expected download job to be resumed via processJobFunc, got %v", resumed)
+	}
+
+	rec, ok := store.Get("dl-1")
+	if !ok {
+		t.Fatal("expected job record to still exist")
+	}
+	if rec.Job.Status != StatusProcessing {
+		t.Fatalf("recoverInterruptedJobs itself should not touch a resumable job's status, got %v", rec.Job.Status)
+	}
+}
+
+func TestRecoverInterruptedJobsFailsNonResumableTypes(t *testing.T) {
+	orig := processJobFunc
+	processJobFunc = func(job Job, payload map[string]interface{}) {
+		t.Fatalf("processJobFunc should not be called for a non-resumable job type, got %q", job.Type)
+	}
+	t.Cleanup(func() { processJobFunc = orig })
+
+	store := newMemoryJobStore()
+	store.Put(JobRecord{Job: Job{ID: "weird-1", Type: "not-a-real-type", Status: StatusPending}})
+
+	recoverInterruptedJobs(store)
+
+	rec, ok := store.Get("weird-1")
+	if !ok {
+		t.Fatal("expected job record to still exist")
+	}
+	if rec.Job.Status != StatusFailed {
+		t.Fatalf("expected non-resumable interrupted job to be marked failed, got %v", rec.Job.Status)
+	}
+	if rec.Job.Details == "" {
+		t.Fatal("expected failure details to be set")
+	}
+}
+
+func TestRecoverInterruptedJobsLeavesTerminalJobsAlone(t *testing.T) {
+	orig := processJobFunc
+	processJobFunc = func(job Job, payload map[string]interface{}) {
+		t.Fatalf("processJobFunc should not be called for an already-terminal job, got %q", job.ID)
+	}
+	t.Cleanup(func() { processJobFunc = orig })
+
+	store := newMemoryJobStore()
+	store.Put(JobRecord{Job: Job{ID: "done-1", Type: "download", Status: StatusCompleted}})
+	store.Put(JobRecord{Job: Job{ID: "failed-1", Type: "download", Status: StatusFailed}})
+
+	recoverInterruptedJobs(store)
+
+	for _, id := range []string{"done-1", "failed-1"} {
+		rec, ok := store.Get(id)
+		if !ok {
+			t.Fatalf("expected job %q to still exist", id)
+		}
+		if rec.Job.Status != StatusCompleted && rec.Job.Status != StatusFailed {
+			t.Fatalf("expected job %q to keep its terminal status, got %v", id, rec.Job.Status)
+		}
+	}
+}
+
+func TestPruneOnceDeletesOldTerminalJobsOnly(t *testing.T) {
+	store := newMemoryJobStore()
+	old := time.Now().Add(-100 * time.Hour)
+	recent := time.Now()
+
+	store.Put(JobRecord{Job: Job{ID: "old-completed", Status: StatusCompleted, UpdatedAt: old}})
+	store.Put(JobRecord{Job: Job{ID: "old-pending", Status: StatusPending, UpdatedAt: old}})
+	store.Put(JobRecord{Job: Job{ID: "recent-completed", Status: StatusCompleted, UpdatedAt: recent}})
+
+	pruneOnce(store, 72*time.Hour)
+
+	if _, ok := store.Get("old-completed"); ok {
+		t.Fatal("expected old completed job to be pruned")
+	}
+	if _, ok := store.Get("old-pending"); !ok {
+		t.Fatal("expected old but non-terminal job to survive pruning")
+	}
+	if _, ok := store.Get("recent-completed"); !ok {
+		t.Fatal("expected recent completed job to survive pruning")
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"archive/tar"
 	"archive/zip"
+	"bufio"
 	"compress/gzip"
 	"embed" // <-- NEW: Import embed package
 	"fmt"
@@ -13,16 +14,19 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	ffmpeg "github.com/u2takey/ffmpeg-go"
 )
 
-//go:embed templates/* <-- NEW: Directive to embed all files in templates/
-var templatesFS embed.FS // <-- NEW: Variable to hold the embedded files
+// Directive to embed all files in templates/
+//
+//go:embed templates/*
+var templatesFS embed.FS // Variable to hold the embedded files
 
 // --- Data Structures ---
 type JobStatus string
@@ -35,29 +39,31 @@ const (
 )
 
 type Job struct {
-	ID        string    `json:"id"`
-	Type      string    `json:"type"`
-	Status    JobStatus `json:"status"`
-	Details   string    `json:"details"`
-	ResultURL string    `json:"result_url,omitempty"` // URL to download the result
+	ID        string         `json:"id"`
+	Type      string         `json:"type"`
+	Status    JobStatus      `json:"status"`
+	Details   string         `json:"details"`
+	ResultURL string         `json:"result_url,omitempty"` // URL to download the result
+	Progress  *ProgressEvent `json:"progress,omitempty"`
+	UpdatedAt time.Time      `json:"updated_at"`
 }
 
-var jobStore = sync.Map{}
+var jobStore JobStore
 
 // --- Helper Functions ---
 
 func updateJob(id string, status JobStatus, details string, resultURL string) {
-	val, ok := jobStore.Load(id)
+	rec, ok := jobStore.Get(id)
 	if !ok {
 		return
 	}
-	job := val.(Job)
-	job.Status = status
-	job.Details = details
+	rec.Job.Status = status
+	rec.Job.Details = details
 	if resultURL != "" {
-		job.ResultURL = resultURL
+		rec.Job.ResultURL = resultURL
 	}
-	jobStore.Store(id, job)
+	rec.Job.UpdatedAt = time.Now()
+	jobStore.Put(rec)
 }
 
 // Security: Prevent Zip Slip
@@ -70,7 +76,7 @@ func sanitizePath(dest, path string) (string, error) {
 }
 
 // --- Decompression Logic ---
-func unzipSource(source, dest string) error {
+func unzipSource(jobID, source, dest string) error {
 	r, err := zip.OpenReader(source)
 	if err != nil {
 		return err
@@ -78,6 +84,13 @@ func unzipSource(source, dest string) error {
 	defer r.Close()
 	os.MkdirAll(dest, 0755)
 
+	var total int64
+	for _, f := range r.File {
+		total += int64(f.UncompressedSize64)
+	}
+	var done int64
+	lastReport := time.Now()
+
 	for _, f := range r.File {
 		fpath, err := sanitizePath(dest, f.Name)
 		if err != nil {
@@ -100,17 +113,27 @@ func unzipSource(source, dest string) error {
 			outFile.Close()
 			return err
 		}
-		_, err = io.Copy(outFile, rc)
+		n, err := io.Copy(outFile, rc)
 		outFile.Close()
 		rc.Close()
 		if err != nil {
 			return err
 		}
+		done += n
+		if now := time.Now(); now.Sub(lastReport) >= progressThrottle {
+			lastReport = now
+			ev := ProgressEvent{Stage: "extract", BytesDone: done, BytesTotal: total}
+			if total > 0 {
+				ev.Percent = float64(done) / float64(total) * 100
+			}
+			updateJobProgress(jobID, ev)
+		}
 	}
+	updateJobProgress(jobID, ProgressEvent{Stage: "extract", BytesDone: done, BytesTotal: total, Percent: 100, Done: true})
 	return nil
 }
 
-func untarSource(source, dest string) error {
+func untarSource(jobID, source, dest string) error {
 	f, err := os.Open(source)
 	if err != nil {
 		return err
@@ -121,9 +144,19 @@ func untarSource(source, dest string) error {
 		return err
 	}
 	defer gzr.Close()
-	tr := tar.NewReader(gzr)
+	return extractTarStream(jobID, tar.NewReader(gzr), dest)
+}
+
+// extractTarStream walks a tar entry stream, regardless of what
+// decompressor produced it, and reports bytes-processed progress as it
+// goes. Total size isn't known upfront for a streamed archive, so only
+// bytes done (not a percentage) is reported.
+func extractTarStream(jobID string, tr *tar.Reader, dest string) error {
 	os.MkdirAll(dest, 0755)
 
+	var done int64
+	lastReport := time.Now()
+
 	for {
 		header, err := tr.Next()
 		if err == io.EOF {
@@ -150,13 +183,19 @@ func untarSource(source, dest string) error {
 			if err != nil {
 				return err
 			}
-			if _, err := io.Copy(outFile, tr); err != nil {
-				outFile.Close()
+			n, err := io.Copy(outFile, tr)
+			outFile.Close()
+			if err != nil {
 				return err
 			}
-			outFile.Close()
+			done += n
+			if now := time.Now(); now.Sub(lastReport) >= progressThrottle {
+				lastReport = now
+				updateJobProgress(jobID, ProgressEvent{Stage: "extract", BytesDone: done})
+			}
 		}
 	}
+	updateJobProgress(jobID, ProgressEvent{Stage: "extract", BytesDone: done, Percent: 100, Done: true})
 	return nil
 }
 
@@ -167,7 +206,7 @@ func unrarSource(source, dest string) error {
 }
 
 // --- Download & Zip Logic ---
-func downloadFile(url string, customName string, destFolder string) (string, error) {
+func downloadFile(jobID string, url string, customName string, destFolder string) (string, error) {
 	resp, err := http.Get(url)
 	if err != nil {
 		return "", err
@@ -197,11 +236,15 @@ func downloadFile(url string, customName string, destFolder string) (string, err
 		return "", err
 	}
 	defer out.Close()
-	_, err = io.Copy(out, resp.Body)
+
+	pr := newProgressReader(resp.Body, "download", resp.ContentLength, func(ev ProgressEvent) {
+		updateJobProgress(jobID, ev)
+	})
+	_, err = io.Copy(out, pr)
 	return finalPath, err
 }
 
-func zipFile(sourcePath string, destFolder string) (string, error) {
+func zipFile(jobID string, sourcePath string, destFolder string) (string, error) {
 	filename := filepath.Base(sourcePath)
 	zipName := fmt.Sprintf("%s_%s.zip", strings.TrimSuffix(filename, filepath.Ext(filename)), uuid.New().String()[:8])
 	zipPath := filepath.Join(destFolder, zipName)
@@ -221,12 +264,20 @@ func zipFile(sourcePath string, destFolder string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	_, err = io.Copy(f, srcFile)
+
+	var total int64
+	if info, statErr := srcFile.Stat(); statErr == nil {
+		total = info.Size()
+	}
+	pr := newProgressReader(srcFile, "zip", total, func(ev ProgressEvent) {
+		updateJobProgress(jobID, ev)
+	})
+	_, err = io.Copy(f, pr)
 	return zipPath, nil
 }
 
 // --- REMUX LOGIC (In-Place) ---
-func remuxFile(relativePath string, container string, outputName string) (string, error) {
+func remuxFile(jobID string, relativePath string, container string, outputName string) (string, error) {
 	// Full path to source
 	sourcePath := filepath.Join("./downloads", relativePath)
 
@@ -249,13 +300,10 @@ func remuxFile(relativePath string, container string, outputName string) (string
 	// Output goes to same directory as source
 	outPath := filepath.Join(sourceDir, finalName)
 
-	// FFmpeg command: -c copy (Remuxing, no re-encoding)
-	err := ffmpeg.Input(sourcePath).
-		Output(outPath, ffmpeg.KwArgs{"c": "copy"}).
-		OverWriteOutput().
-		Run()
-
-	if err != nil {
+	// FFmpeg command: -c copy (Remuxing, no re-encoding). We shell out
+	// directly instead of going through the ffmpeg-go wrapper so we can
+	// read -progress pipe:1 and surface live frame/time updates.
+	if err := runRemuxWithProgress(jobID, sourcePath, outPath); err != nil {
 		return "", fmt.Errorf("ffmpeg error: %v", err)
 	}
 
@@ -264,6 +312,71 @@ func remuxFile(relativePath string, container string, outputName string) (string
 	return relPath, nil
 }
 
+// runRemuxWithProgress runs ffmpeg -c copy and parses its `-progress
+// pipe:1` key=value stream, forwarding out_time_us as bytes-equivalent
+// progress (container remux has no reliable byte total up front, so we
+// report elapsed media time rather than a percentage).
+func runRemuxWithProgress(jobID, sourcePath, outPath string) error {
+	cmd := exec.Command("ffmpeg", "-y", "-i", sourcePath, "-c", "copy", "-progress", "pipe:1", "-nostats", outPath)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	lastReport := start
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "out_time_us="):
+			us, perr := strconv.ParseInt(strings.TrimPrefix(line, "out_time_us="), 10, 64)
+			if perr != nil {
+				continue
+			}
+			if now := time.Now(); now.Sub(lastReport) >= progressThrottle {
+				lastReport = now
+				elapsed := now.Sub(start).Seconds()
+				rate := 0.0
+				if elapsed > 0 {
+					rate = float64(us) / 1e6 / elapsed // seconds of media per wall second
+				}
+				updateJobProgress(jobID, ProgressEvent{Stage: "remux", BytesDone: us / 1000, RateBps: rate})
+			}
+		case line == "progress=end":
+			updateJobProgress(jobID, ProgressEvent{Stage: "remux", Percent: 100, Done: true})
+		}
+	}
+	return cmd.Wait()
+}
+
+// submitJob persists a new job record and kicks off its worker, the
+// common path shared by every /api/* endpoint that starts async work.
+func submitJob(jobType string, payload map[string]interface{}) Job {
+	job := Job{ID: uuid.New().String(), Type: jobType, Status: StatusPending, UpdatedAt: time.Now()}
+	jobStore.Put(JobRecord{Job: job, Payload: payload})
+	go processJob(job, payload)
+	return job
+}
+
+// payloadInt reads an integer field from a job payload. Payloads built
+// in-process from a JSON-bound request struct carry Go ints, but a
+// payload round-tripped through jobStore (bbolt encodes it as JSON)
+// comes back with every number as float64, so both are accepted.
+func payloadInt(payload map[string]interface{}, key string) (int, bool) {
+	switch v := payload[key].(type) {
+	case int:
+		return v, true
+	case float64:
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
+
 // --- Worker ---
 func processJob(job Job, payload map[string]interface{}) {
 	updateJob(job.ID, StatusProcessing, "Starting...", "")
@@ -275,7 +388,17 @@ func processJob(job Job, payload map[string]interface{}) {
 	case "download":
 		url := payload["url"].(string)
 		customName := payload["custom_name"].(string)
-		absPath, e := downloadFile(url, customName, "./downloads")
+		opts := DownloadOptions{Segments: 1}
+		if v, ok := payloadInt(payload, "segments"); ok {
+			opts.Segments = v
+		}
+		if v, ok := payload["resume"].(bool); ok {
+			opts.Resume = v
+		}
+		if v, ok := payloadInt(payload, "max_retries"); ok {
+			opts.MaxRetries = v
+		}
+		absPath, e := downloadWithOptions(job.ID, url, customName, "./downloads", opts)
 		err = e
 		if err == nil {
 			resultPath = filepath.Base(absPath)
@@ -283,7 +406,7 @@ func processJob(job Job, payload map[string]interface{}) {
 				updateJob(job.ID, StatusProcessing, "Zipping...", "")
 				// Zip goes to downloads too for simplicity now? Or keep output?
 				// Let's keep existing zip logic but return that URL
-				zipP, zErr := zipFile(absPath, "./downloads")
+				zipP, zErr := zipFile(job.ID, absPath, "./downloads")
 				if zErr == nil {
 					resultPath = filepath.Base(zipP)
 				}
@@ -296,37 +419,51 @@ func processJob(job Job, payload map[string]interface{}) {
 		container := payload["container"].(string)
 		customOut, _ := payload["custom_out"].(string)
 
-		resultPath, err = remuxFile(relPath, container, customOut)
+		resultPath, err = remuxFile(job.ID, relPath, container, customOut)
 
 	case "extract":
 		relPath := payload["filename"].(string)
 		sourcePath := filepath.Join("./downloads", relPath)
 		// Extract to: downloads/folder_name/
-		destFolder := strings.TrimSuffix(sourcePath, filepath.Ext(sourcePath))
+		destFolder := stripArchiveExt(sourcePath)
 
-		ext := strings.ToLower(filepath.Ext(sourcePath))
 		updateJob(job.ID, StatusProcessing, "Extracting...", "")
 
-		if ext == ".zip" {
-			err = unzipSource(sourcePath, destFolder)
-		} else if ext == ".gz" || strings.HasSuffix(sourcePath, ".tar.gz") {
-			err = untarSource(sourcePath, destFolder)
-		} else if ext == ".rar" {
-			err = unrarSource(sourcePath, destFolder)
-		} else {
-			err = fmt.Errorf("unsupported format: %s", ext)
+		var ex Extractor
+		ex, err = detectExtractor(sourcePath)
+		if err == nil {
+			err = ex.Extract(job.ID, sourcePath, destFolder)
 		}
 		// Result path for extraction is the folder name
 		if err == nil {
 			resultPath, _ = filepath.Rel("./downloads", destFolder)
 		}
+
+	case "archive":
+		relPath := payload["path"].(string)
+		format, _ := payload["format"].(string)
+		if format == "" {
+			format = "zip"
+		}
+		sourceDir := filepath.Join("./downloads", relPath)
+		if !strings.HasPrefix(filepath.Clean(sourceDir), filepath.Clean("./downloads")) {
+			err = fmt.Errorf("illegal file path: %s", relPath)
+			break
+		}
+		updateJob(job.ID, StatusProcessing, "Archiving...", "")
+
+		var archivePath string
+		archivePath, err = archiveFolder(job.ID, sourceDir, "./downloads", format)
+		if err == nil {
+			resultPath = filepath.Base(archivePath)
+		}
 	}
 
 	if err != nil {
 		updateJob(job.ID, StatusFailed, err.Error(), "")
 	} else {
-		// Public URL is /raw/ + relative path
-		publicURL := "/raw/" + resultPath
+		// Public URL is /raw/ + relative path, signed+expiring when auth is configured.
+		publicURL := signResultURL("/raw/"+resultPath, resultURLTTL)
 		updateJob(job.ID, StatusCompleted, "Done", publicURL)
 	}
 }
@@ -341,14 +478,35 @@ func main() {
 	r.SetHTMLTemplate(tmpl)
 
 	os.MkdirAll("./downloads", 0755)
+	os.MkdirAll("./data", 0755)
+
+	if store, err := newBoltJobStore(filepath.Join("./data", "jobs.db")); err == nil {
+		jobStore = store
+	} else {
+		fmt.Printf("warning: could not open job store (%v), falling back to in-memory\n", err)
+		jobStore = newMemoryJobStore()
+	}
+	recoverInterruptedJobs(jobStore)
+	go pruneLoop(jobStore, 72*time.Hour)
+
+	if !authRequired() {
+		fmt.Println("warning: ADMIN_TOKEN not set, /api and /raw are unauthenticated")
+	}
 
-	// Serve downloads folder directly
-	r.StaticFS("/raw", http.Dir("./downloads"))
+	// Serve downloads folder directly; signed+expiring when ADMIN_TOKEN is set.
+	rawGroup := r.Group("/raw", requireSignedURL())
+	rawGroup.StaticFS("/", http.Dir("./downloads"))
+
+	rawArchiveGroup := r.Group("/raw-archive", requireSignedURL())
+	rawArchiveGroup.GET("/*archivePath", handleRawArchive)
 
 	r.GET("/", func(c *gin.Context) { c.HTML(http.StatusOK, "index.html", nil) })
 
+	// Everything under /api requires the admin token (bearer or HTTP Basic).
+	api := r.Group("/api", requireAdminToken())
+
 	// List files with dir support
-	r.GET("/api/files", func(c *gin.Context) {
+	api.GET("/files", func(c *gin.Context) {
 		reqDir := c.DefaultQuery("dir", "")
 		baseDir := "./downloads"
 		targetDir := filepath.Join(baseDir, reqDir)
@@ -358,6 +516,37 @@ func main() {
 			return
 		}
 
+		// Descend into an archive exactly like a directory, without an
+		// explicit extract job, e.g. dir=foo.zip/subdir.
+		if archiveRel, inner, ok := splitArchiveBoundary(reqDir); ok {
+			archivePath := filepath.Join(baseDir, archiveRel)
+			entries, err := listArchive(archivePath, inner)
+			if err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+			parent := filepath.ToSlash(filepath.Dir(reqDir))
+			if parent == "." {
+				parent = ""
+			}
+			files := []gin.H{{"name": "..", "type": "dir", "path": parent}}
+			for _, e := range entries {
+				fileType := "file"
+				rawURL := ""
+				if e.IsDir {
+					fileType = "dir"
+				} else {
+					rawURL = signResultURL("/raw-archive/"+archiveRel+"!/"+e.Path, resultURLTTL)
+				}
+				files = append(files, gin.H{
+					"name": e.Name, "size": e.Size, "type": fileType,
+					"path": archiveRel + "/" + e.Path, "raw_url": rawURL,
+				})
+			}
+			c.JSON(http.StatusOK, gin.H{"files": files, "current": reqDir})
+			return
+		}
+
 		entries, err := os.ReadDir(targetDir)
 		if err != nil {
 			c.JSON(500, gin.H{"error": "Cannot read directory"})
@@ -387,7 +576,7 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"files": files, "current": reqDir})
 	})
 
-	r.DELETE("/api/files", func(c *gin.Context) {
+	api.DELETE("/files", func(c *gin.Context) {
 		relativePath := c.Query("path")
 		if relativePath == "" {
 			c.JSON(400, gin.H{"error": "path required"})
@@ -406,24 +595,27 @@ func main() {
 		c.JSON(200, gin.H{"status": "deleted"})
 	})
 
-	r.POST("/api/download", func(c *gin.Context) {
+	api.POST("/download", func(c *gin.Context) {
 		var req struct {
 			URL        string `json:"url"`
 			CustomName string `json:"custom_name"`
 			AutoZip    bool   `json:"auto_zip"`
+			Segments   int    `json:"segments"`
+			Resume     bool   `json:"resume"`
+			MaxRetries int    `json:"max_retries"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(400, gin.H{"error": err.Error()})
 			return
 		}
-		jobID := uuid.New().String()
-		job := Job{ID: jobID, Type: "download", Status: StatusPending}
-		jobStore.Store(jobID, job)
-		go processJob(job, map[string]interface{}{"url": req.URL, "custom_name": req.CustomName, "auto_zip": req.AutoZip})
-		c.JSON(202, gin.H{"job_id": jobID})
+		job := submitJob("download", map[string]interface{}{
+			"url": req.URL, "custom_name": req.CustomName, "auto_zip": req.AutoZip,
+			"segments": req.Segments, "resume": req.Resume, "max_retries": req.MaxRetries,
+		})
+		c.JSON(202, gin.H{"job_id": job.ID})
 	})
 
-	r.POST("/api/remux", func(c *gin.Context) {
+	api.POST("/remux", func(c *gin.Context) {
 		var req struct {
 			Filename  string `json:"filename"`
 			Container string `json:"container"`
@@ -433,14 +625,11 @@ func main() {
 			c.JSON(400, gin.H{"error": err.Error()})
 			return
 		}
-		jobID := uuid.New().String()
-		job := Job{ID: jobID, Type: "remux", Status: StatusPending}
-		jobStore.Store(jobID, job)
-		go processJob(job, map[string]interface{}{"filename": req.Filename, "container": req.Container, "custom_out": req.CustomOut})
-		c.JSON(202, gin.H{"job_id": jobID})
+		job := submitJob("remux", map[string]interface{}{"filename": req.Filename, "container": req.Container, "custom_out": req.CustomOut})
+		c.JSON(202, gin.H{"job_id": job.ID})
 	})
 
-	r.POST("/api/extract", func(c *gin.Context) {
+	api.POST("/extract", func(c *gin.Context) {
 		var req struct {
 			Filename string `json:"filename"`
 		}
@@ -448,22 +637,77 @@ func main() {
 			c.JSON(400, gin.H{"error": err.Error()})
 			return
 		}
-		jobID := uuid.New().String()
-		job := Job{ID: jobID, Type: "extract", Status: StatusPending}
-		jobStore.Store(jobID, job)
-		go processJob(job, map[string]interface{}{"filename": req.Filename})
-		c.JSON(202, gin.H{"job_id": jobID})
+		job := submitJob("extract", map[string]interface{}{"filename": req.Filename})
+		c.JSON(202, gin.H{"job_id": job.ID})
+	})
+
+	// Virtual, read-only browsing of an archive's contents without extracting it.
+	api.GET("/archive/list", handleArchiveList)
+
+	api.POST("/archive", func(c *gin.Context) {
+		var req struct {
+			Path   string `json:"path"`
+			Format string `json:"format"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		job := submitJob("archive", map[string]interface{}{"path": req.Path, "format": req.Format})
+		c.JSON(202, gin.H{"job_id": job.ID})
 	})
 
-	r.GET("/api/job/:id", func(c *gin.Context) {
+	api.GET("/job/:id", func(c *gin.Context) {
 		id := c.Param("id")
-		if val, ok := jobStore.Load(id); ok {
-			c.JSON(200, val)
+		if rec, ok := jobStore.Get(id); ok {
+			c.JSON(200, rec.Job)
 		} else {
 			c.JSON(404, gin.H{"error": "Not found"})
 		}
 	})
 
+	// List/paginate jobs, e.g. /api/jobs?status=completed&type=download&since=1690000000&offset=100&limit=50
+	api.GET("/jobs", func(c *gin.Context) {
+		statusFilter := JobStatus(c.Query("status"))
+		typeFilter := c.Query("type")
+		var since time.Time
+		if s := c.Query("since"); s != "" {
+			if unix, err := strconv.ParseInt(s, 10, 64); err == nil {
+				since = time.Unix(unix, 0)
+			}
+		}
+		limit := 100
+		if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+			limit = l
+		}
+		offset := 0
+		if o, err := strconv.Atoi(c.Query("offset")); err == nil && o > 0 {
+			offset = o
+		}
+		recs := jobStore.List(statusFilter, typeFilter, since)
+		// Sort newest-first so offset/limit is a stable, reproducible
+		// page rather than a slice of bbolt's key (UUID) iteration order.
+		sort.Slice(recs, func(i, j int) bool {
+			return recs[i].Job.UpdatedAt.After(recs[j].Job.UpdatedAt)
+		})
+		total := len(recs)
+		if offset > total {
+			offset = total
+		}
+		recs = recs[offset:]
+		if len(recs) > limit {
+			recs = recs[:limit]
+		}
+		jobs := make([]Job, 0, len(recs))
+		for _, rec := range recs {
+			jobs = append(jobs, rec.Job)
+		}
+		c.JSON(200, gin.H{"jobs": jobs, "total": total, "offset": offset, "limit": limit})
+	})
+
+	// Live progress for a job, streamed as Server-Sent Events.
+	api.GET("/job/:id/events", sseJobEvents)
+
 	fmt.Println("Running on http://localhost:8080")
 	r.Run("0.0.0.0:8080")
 }
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// progressThrottle bounds how often a single copy updates jobStore/SSE
+// subscribers. ffmpeg and large downloads can emit far more often than
+// anyone is watching, so we coalesce to this cadence.
+const progressThrottle = 250 * time.Millisecond
+
+// ProgressEvent is a point-in-time snapshot of a job's transfer progress,
+// sent both as the Job.Progress field and as SSE deltas.
+type ProgressEvent struct {
+	Stage      string  `json:"stage"`
+	BytesDone  int64   `json:"bytes_done"`
+	BytesTotal int64   `json:"bytes_total,omitempty"`
+	Percent    float64 `json:"percent"`
+	RateBps    float64 `json:"rate_bps"`
+	ETASeconds float64 `json:"eta_seconds,omitempty"`
+	Done       bool    `json:"done,omitempty"`
+}
+
+// progressHub fans a job's progress events out to any SSE clients
+// currently watching it.
+type progressHub struct {
+	mu   sync.Mutex
+	subs map[string][]chan ProgressEvent
+}
+
+var progressBroadcaster = &progressHub{subs: make(map[string][]chan ProgressEvent)}
+
+func (h *progressHub) subscribe(jobID string) chan ProgressEvent {
+	ch := make(chan ProgressEvent, 8)
+	h.mu.Lock()
+	h.subs[jobID] = append(h.subs[jobID], ch)
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *progressHub) unsubscribe(jobID string, ch chan ProgressEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs := h.subs[jobID]
+	for i, c := range subs {
+		if c == ch {
+			h.subs[jobID] = append(subs[:i], subs[i+1:]...)
+			close(ch)
+			break
+		}
+	}
+	if len(h.subs[jobID]) == 0 {
+		delete(h.subs, jobID)
+	}
+}
+
+func (h *progressHub) publish(jobID string, ev ProgressEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ch := range h.subs[jobID] {
+		select {
+		case ch <- ev:
+		default:
+			// Slow subscriber; drop the update rather than block the job.
+		}
+	}
+}
+
+// updateJobProgress records the latest progress snapshot on the job and
+// notifies any SSE subscribers. Unlike updateJob it never touches status
+// or details, so it's safe to call from a throttled copy loop without
+// clobbering concurrent state.
+func updateJobProgress(id string, ev ProgressEvent) {
+	rec, ok := jobStore.Get(id)
+	if !ok {
+		return
+	}
+	evCopy := ev
+	rec.Job.Progress = &evCopy
+	jobStore.Put(rec)
+	progressBroadcaster.publish(id, ev)
+}
+
+// progressReader wraps an io.Reader and reports cumulative bytes read to
+// onProgress at most once per progressThrottle, plus a final report on EOF.
+type progressReader struct {
+	r          io.Reader
+	stage      string
+	total      int64
+	done       int64
+	startTime  time.Time
+	lastReport time.Time
+	onProgress func(ev ProgressEvent)
+}
+
+func newProgressReader(r io.Reader, stage string, total int64, onProgress func(ev ProgressEvent)) *progressReader {
+	now := time.Now()
+	return &progressReader{r: r, stage: stage, total: total, startTime: now, lastReport: now, onProgress: onProgress}
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.done += int64(n)
+
+	now := time.Now()
+	finished := err != nil
+	if finished || now.Sub(pr.lastReport) >= progressThrottle {
+		pr.lastReport = now
+		elapsed := now.Sub(pr.startTime).Seconds()
+		rate := 0.0
+		if elapsed > 0 {
+			rate = float64(pr.done) / elapsed
+		}
+		ev := ProgressEvent{Stage: pr.stage, BytesDone: pr.done, BytesTotal: pr.total, RateBps: rate, Done: finished && err == io.EOF}
+		if pr.total > 0 {
+			ev.Percent = float64(pr.done) / float64(pr.total) * 100
+			if rate > 0 {
+				ev.ETASeconds = float64(pr.total-pr.done) / rate
+			}
+		}
+		pr.onProgress(ev)
+	}
+	return n, err
+}
+
+// sseJobEvents streams JSON progress deltas for a job as Server-Sent
+// Events so the UI can render a live bar instead of polling /api/job/:id.
+func sseJobEvents(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := jobStore.Get(id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming unsupported"})
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Subscribe first, then re-fetch the job. If we snapshotted before
+	// subscribing, a terminal publish landing in that gap would be
+	// missed entirely and we'd report a stale non-terminal snapshot,
+	// fall into the loop below, and hang forever waiting on a channel
+	// nothing will ever write to again.
+	ch := progressBroadcaster.subscribe(id)
+	defer progressBroadcaster.unsubscribe(id, ch)
+
+	rec, ok := jobStore.Get(id)
+	if !ok {
+		return
+	}
+
+	terminal := rec.Job.Status == StatusCompleted || rec.Job.Status == StatusFailed
+	snapshot := rec.Job.Progress
+	if snapshot == nil {
+		snapshot = &ProgressEvent{Stage: string(rec.Job.Status), Done: terminal}
+	} else if terminal {
+		snapshot.Done = true
+	}
+	data, _ := json.Marshal(snapshot)
+	fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+	flusher.Flush()
+	if terminal {
+		return
+	}
+
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+			flusher.Flush()
+			if ev.Done {
+				return
+			}
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}